@@ -35,15 +35,19 @@ offset, as usual.
 package resource
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
 )
 
 var (
@@ -59,16 +63,334 @@ var (
 	LoadUnsupported       = false
 )
 
+// fileNamesFor returns the index -> name table for the given archive Type,
+// as registered in archiveKinds (see RegisterArchiveType and
+// RegisterFileNames). fileMap, the original DOS table, is the fallback for
+// an unregistered Type so existing callers that never touched the registry
+// keep working.
+func fileNamesFor(typ string) []string {
+	if k, ok := archiveKindForType(typ); ok && k.names != nil {
+		return k.names
+	}
+	return fileMap
+}
+
+// entry describes a single fileMap slot. The data itself is only read and
+// decompressed on demand, from Archive.Open; OpenArchiveFrom only needs
+// enough of the header to know where each entry lives.
+type entry struct {
+	name          string
+	placeholder   bool
+	dataOffset    int64 // offset of the entry's data, past its 4 byte size field
+	dataLength    int   // length of the stored (possibly compressed) bytes
+	size          int   // declared decompressed size
+	compressionID byte  // 0 means raw; otherwise looked up via decompressorFor
+}
+
+// Archive is a lazily-read WAR archive. Entries are only decompressed when
+// Open is called, so opening an Archive is cheap regardless of how much
+// game data it holds. Archive implements fs.FS, fs.ReadDirFS and fs.StatFS,
+// so it can be used anywhere those are accepted, e.g. fs.WalkDir, fs.Sub,
+// http.FS or template.ParseFS.
 type Archive struct {
-	Type  string
-	Files map[string][]byte
+	Type string
+
+	ra             io.ReaderAt
+	nativeReaderAt bool // false if ra is a readerAtSeeker wrapping a plain ReadSeeker
+	size           int64
+	closer         io.Closer
+	entries        []entry
+	index          map[string]int // name -> index into entries
 }
 
-func (a *Archive) Open(file string) (io.Reader, error) {
-	if f, ok := a.Files[file]; ok {
-		return bytes.NewReader(f), nil
+// readerAtSeeker adapts an io.ReadSeeker that doesn't already implement
+// io.ReaderAt (most notably bytes.Reader-like callers are fine, but a plain
+// network stream is not) into one, by seeking under a lock for every read.
+type readerAtSeeker struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (r *readerAtSeeker) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
 	}
-	return nil, os.ErrNotExist
+	return io.ReadFull(r.rs, p)
+}
+
+// Open implements fs.FS. name is looked up against the archive's fileMap
+// names; placeholders and unknown names report fs.ErrNotExist. The root
+// path "." opens a synthetic directory listing every entry, so that
+// fs.WalkDir, fs.Sub and fstest.TestFS all work against an Archive.
+func (a *Archive) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &rootDir{a: a}, nil
+	}
+
+	i, ok := a.index[name]
+	if !ok || a.entries[i].placeholder {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	e := a.entries[i]
+	raw := make([]byte, e.dataLength)
+	// A ReaderAt may report io.EOF alongside a full read that ends at the
+	// end of its input (bytes.Reader does for an empty last entry), so only
+	// a short read is an error.
+	if n, err := a.ra.ReadAt(raw, e.dataOffset); n < len(raw) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	var data []byte
+	if e.compressionID == 0 {
+		data = raw
+	} else {
+		fn, ok := decompressorFor(e.compressionID)
+		if !ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("resource: no decompressor registered for id 0x%02x", e.compressionID)}
+		}
+
+		var err error
+		if data, err = fn(bytes.NewReader(raw), e.size, e.dataLength); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	return &openFile{name: name, size: len(data), Reader: bytes.NewReader(data)}, nil
+}
+
+// Stat implements fs.StatFS.
+func (a *Archive) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return rootInfo{}, nil
+	}
+
+	i, ok := a.index[name]
+	if !ok || a.entries[i].placeholder {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fileInfo{a.entries[i].name, int64(a.entries[i].size)}, nil
+}
+
+// ReadDir implements fs.ReadDirFS. The archive has no real directory
+// structure, so only the root is listable; it lists every non-placeholder
+// entry, sorted by name as fs.ReadDirFS requires.
+func (a *Archive) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var dirs []fs.DirEntry
+	for _, e := range a.entries {
+		if e.placeholder {
+			continue
+		}
+		dirs = append(dirs, dirEntry{fileInfo{e.name, int64(e.size)}})
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Name() < dirs[j].Name() })
+	return dirs, nil
+}
+
+// Close releases the underlying file, if Archive opened it itself (see
+// OpenArchive). Archives built from OpenArchiveFrom own nothing and Close
+// is a no-op.
+func (a *Archive) Close() error {
+	if a.closer != nil {
+		return a.closer.Close()
+	}
+	return nil
+}
+
+// LoadAllOptions configures the eager LoadAll extraction path.
+type LoadAllOptions struct {
+	// Concurrency is the number of goroutines used to decompress entries
+	// in parallel. Values of 1 or less fall back to the serial path, as
+	// does any Archive whose reader had to be wrapped in a readerAtSeeker,
+	// since that wrapper serializes on a single lock anyway.
+	Concurrency int
+}
+
+// LoadAll eagerly decompresses every entry in the archive and returns it as
+// a plain name -> bytes map, matching the behaviour this package used to
+// have before Archive became lazy.
+func LoadAll(a *Archive) (map[string][]byte, error) {
+	return LoadAllWithOptions(a, LoadAllOptions{})
+}
+
+// LoadAllWithOptions is LoadAll with control over how many entries are
+// decompressed concurrently. This mirrors the parallel-compression approach
+// fastzip uses: each entry's byte range is already known from the file
+// table, so entries can be read and decompressed independently and merged
+// into the result afterwards.
+func LoadAllWithOptions(a *Archive, opts LoadAllOptions) (map[string][]byte, error) {
+	if opts.Concurrency <= 1 || !a.nativeReaderAt {
+		return loadAllSerial(a)
+	}
+	return loadAllConcurrent(a, opts.Concurrency)
+}
+
+func loadAllSerial(a *Archive) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(a.entries))
+	for _, e := range a.entries {
+		if e.placeholder {
+			continue
+		}
+
+		f, err := a.Open(e.name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[e.name] = data
+	}
+	return files, nil
+}
+
+func loadAllConcurrent(a *Archive, n int) (map[string][]byte, error) {
+	type result struct {
+		name string
+		data []byte
+		err  error
+	}
+
+	jobs := make(chan string)
+	results := make(chan result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				f, err := a.Open(name)
+				if err != nil {
+					results <- result{name: name, err: err}
+					continue
+				}
+				data, err := ioutil.ReadAll(f)
+				f.Close()
+				results <- result{name, data, err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, e := range a.entries {
+			if !e.placeholder {
+				jobs <- e.name
+			}
+		}
+		close(jobs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	files := make(map[string][]byte, len(a.entries))
+	var firstErr error
+	for r := range results {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		files[r.name] = r.data
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return files, nil
+}
+
+type openFile struct {
+	name string
+	size int
+	*bytes.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return fileInfo{f.name, int64(f.size)}, nil }
+func (f *openFile) Close() error               { return nil }
+
+type fileInfo struct {
+	name string
+	size int64
+}
+
+func (fi fileInfo) Name() string       { return path.Base(fi.name) }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+type dirEntry struct{ fi fileInfo }
+
+func (d dirEntry) Name() string               { return d.fi.Name() }
+func (d dirEntry) IsDir() bool                { return false }
+func (d dirEntry) Type() fs.FileMode          { return d.fi.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.fi, nil }
+
+// rootInfo is the synthetic fs.FileInfo for the archive root, ".".
+type rootInfo struct{}
+
+func (rootInfo) Name() string       { return "." }
+func (rootInfo) Size() int64        { return 0 }
+func (rootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (rootInfo) ModTime() time.Time { return time.Time{} }
+func (rootInfo) IsDir() bool        { return true }
+func (rootInfo) Sys() interface{}   { return nil }
+
+// rootDir is the fs.File (and fs.ReadDirFile) returned by Archive.Open(".").
+type rootDir struct {
+	a       *Archive
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *rootDir) Stat() (fs.FileInfo, error) { return rootInfo{}, nil }
+func (d *rootDir) Close() error               { return nil }
+
+func (d *rootDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errors.New("is a directory")}
+}
+
+func (d *rootDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.a.ReadDir(".")
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	rest := len(d.entries) - d.offset
+	all := n <= 0
+	if all || n > rest {
+		n = rest
+	}
+	if n == 0 && !all {
+		return nil, io.EOF
+	}
+
+	res := d.entries[d.offset : d.offset+n]
+	d.offset += n
+	return res, nil
 }
 
 func OpenArchive(file string) (*Archive, error) {
@@ -76,14 +398,21 @@ func OpenArchive(file string) (*Archive, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer fp.Close()
 
 	info, err := fp.Stat()
 	if err != nil {
+		fp.Close()
 		return nil, err
 	}
 
-	return OpenArchiveFrom(fp, info.Size())
+	arch, err := OpenArchiveFrom(fp, info.Size())
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+
+	arch.closer = fp
+	return arch, nil
 }
 
 func OpenArchiveFrom(fp io.ReadSeeker, sz int64) (*Archive, error) {
@@ -96,51 +425,56 @@ func OpenArchiveFrom(fp io.ReadSeeker, sz int64) (*Archive, error) {
 		return nil, err
 	}
 
-	arch := &Archive{"", make(map[string][]byte)}
+	arch := &Archive{size: sz}
+	if ra, ok := fp.(io.ReaderAt); ok {
+		arch.ra, arch.nativeReaderAt = ra, true
+	} else {
+		arch.ra = &readerAtSeeker{rs: fp}
+	}
 
 	Logger.Print("Archive ID: ")
-	switch archiveID {
-	case dosRetail:
-		arch.Type = "DOS Retail"
-	case dosShareware:
-		arch.Type = "DOS Shareware"
-	default:
-		switch archiveID {
-		case macRetail:
-			arch.Type = "Mac Retail"
-		case macShareware:
-			arch.Type = "Mac Shareware"
-		default:
-			return nil, errors.New("unknown version")
-		}
+	kind, ok := archiveKindForID(archiveID)
+	if !ok {
+		return nil, errors.New("unknown version")
+	}
+	if !kind.supported {
 		return nil, ErrUnsupportedVersion
 	}
+	arch.Type = kind.typ
 	Logger.Println(arch.Type)
 
+	names := fileNamesFor(kind.typ)
+
 	var numFiles uint32
-	if err = binary.Read(fp, binary.LittleEndian, &numFiles); err != nil {
+	if err = binary.Read(fp, kind.byteOrder, &numFiles); err != nil {
 		return nil, err
 	}
 	Logger.Println("Number of files in archive: ", numFiles)
 
-	if int(numFiles) != len(fileMap) {
+	if int(numFiles) != len(names) {
 		return nil, errors.New("table mapping mismatch")
 	}
 
 	fileTable := make([]uint32, numFiles)
 	for i := range fileTable {
-		if err = binary.Read(fp, binary.LittleEndian, &fileTable[i]); err != nil {
+		if err = binary.Read(fp, kind.byteOrder, &fileTable[i]); err != nil {
 			return nil, err
 		}
 	}
 
+	arch.entries = make([]entry, 0, numFiles)
+	arch.index = make(map[string]int, numFiles)
+
 	for i, offset := range fileTable {
+		fileName := names[i]
+
 		if isPlaceHolder(fileTable, offset, i) {
-			if fileMap[i] != "" {
-				Logger.Printf("Incomplete WAR file. Missing '%v'.\n", fileMap[i])
+			if fileName != "" {
+				Logger.Printf("Incomplete WAR file. Missing '%v'.\n", fileName)
 			}
 
 			Logger.Println("Skipping placeholder: ", i)
+			arch.entries = append(arch.entries, entry{name: fileName, placeholder: true})
 			continue
 		}
 
@@ -149,24 +483,18 @@ func OpenArchiveFrom(fp io.ReadSeeker, sz int64) (*Archive, error) {
 		}
 
 		var size uint32
-		if err = binary.Read(fp, binary.LittleEndian, &size); err != nil {
+		if err = binary.Read(fp, kind.byteOrder, &size); err != nil {
 			return nil, err
 		}
 
-		isCompressed := size>>24 == 0x20
+		compressionID := byte(size >> 24)
 		size &= 0x00FFFFFF
 
-		var dataLength uint32
-		if i == len(fileTable)-1 {
-			dataLength = uint32(sz) - fileTable[i]
-		} else {
-			dataLength = fileTable[i+1] - fileTable[i]
-		}
-		dataLength -= 4
+		dataLength := nextDataOffset(fileTable, i, sz) - fileTable[i] - 4
 
-		fileName := fileMap[i]
 		if fileName == "" {
 			if !LoadUnsupported {
+				arch.entries = append(arch.entries, entry{placeholder: true})
 				continue
 			}
 
@@ -174,26 +502,35 @@ func OpenArchiveFrom(fp io.ReadSeeker, sz int64) (*Archive, error) {
 			fileName = fmt.Sprintf("DATA.WAR.%v", i)
 		}
 
-		var data []byte
-		if isCompressed {
-			Logger.Printf("Compressed entry: #%v %s\n", i, fileName)
-			if data, err = uncompressData(fp, int(size), int(dataLength)); err != nil {
-				return nil, err
-			}
-		} else {
-			Logger.Printf("Uncompressed entry: #%v %s\n", i, fileName)
-			data = make([]byte, size)
-			if num, err := fp.Read(data); num != len(data) || err != nil {
-				return nil, err
-			}
+		e := entry{
+			name:          fileName,
+			dataOffset:    int64(offset) + 4,
+			dataLength:    int(dataLength),
+			size:          int(size),
+			compressionID: compressionID,
 		}
 
-		arch.Files[fileName] = data
+		arch.index[fileName] = len(arch.entries)
+		arch.entries = append(arch.entries, e)
 	}
 
 	return arch, nil
 }
 
+// nextDataOffset returns the offset that bounds entry i's data: the offset
+// of the next table entry that isn't itself a placeholder, or the archive
+// size if every remaining entry is a placeholder. A naive tab[i+1] would
+// produce a bogus length whenever the very next entry is a placeholder
+// sentinel, which is the common case for partial (e.g. Shareware) archives.
+func nextDataOffset(tab []uint32, i int, archiveSize int64) uint32 {
+	for j := i + 1; j < len(tab); j++ {
+		if !isPlaceHolder(tab, tab[j], j) {
+			return tab[j]
+		}
+	}
+	return uint32(archiveSize)
+}
+
 func isPlaceHolder(tab []uint32, offset uint32, i int) bool {
 	if offset == 0x0 || offset == 0xFFFFFFFF {
 		return true
@@ -226,30 +563,66 @@ func readShort(reader io.Reader) (uint16, error) {
 	return short, nil
 }
 
+func readShortBE(reader io.Reader) (uint16, error) {
+	var short uint16
+	if err := binary.Read(reader, binary.BigEndian, &short); err != nil {
+		return 0, err
+	}
+	return short, nil
+}
+
 /*
 The DOS version archives of WarCraft are compressed using a sort of LZ compression.
 This means that at compression time, the algorithm checked if there was the exact same
 sequence of bytes previously written, as is being written now.
 */
 
+// ErrCorruptEntry is returned by uncompressData when the input would write
+// past the entry's declared size, or reference a back-reference window
+// position that hasn't actually been written yet.
+var ErrCorruptEntry = errors.New("resource: corrupt compressed entry")
+
+// uncompressData decodes the DOS LZ bit stream, where back-reference tokens
+// are little-endian.
 func uncompressData(reader io.Reader, fileSize, dataSize int) ([]byte, error) {
+	return uncompressDataToken(reader, fileSize, dataSize, readShort)
+}
+
+// uncompressDataMac decodes the Mac LZ bit stream. It is identical to
+// uncompressData except that, matching the rest of the big-endian Mac WAR
+// layout, back-reference tokens are read big-endian.
+func uncompressDataMac(reader io.Reader, fileSize, dataSize int) ([]byte, error) {
+	return uncompressDataToken(reader, fileSize, dataSize, readShortBE)
+}
+
+func uncompressDataToken(reader io.Reader, fileSize, dataSize int, readToken func(io.Reader) (uint16, error)) ([]byte, error) {
 	const bufferSize = 4096
 	var backingBuffer bytes.Buffer
 
-	writer := bufio.NewWriter(&backingBuffer)
+	if fileSize < 0 || dataSize < 0 {
+		return backingBuffer.Bytes(), ErrCorruptEntry
+	}
+	backingBuffer.Grow(fileSize)
+
 	buffer := make([]byte, bufferSize)
+	var numWrite, numRead int
 
-	var (
-		numWrite,
-		numRead int
-	)
+	emit := func(b byte) error {
+		if numWrite >= fileSize {
+			return ErrCorruptEntry
+		}
+		buffer[numWrite%bufferSize] = b
+		backingBuffer.WriteByte(b)
+		numWrite++
+		return nil
+	}
 
-	for numRead < dataSize {
+	for numRead < dataSize && numWrite < fileSize {
 		cmask, err := readByte(reader)
 		numRead++
 
 		if err != nil {
-			return buffer, err
+			return backingBuffer.Bytes(), err
 		}
 
 		for i := 0; i < 8 && numWrite != fileSize; i++ {
@@ -258,35 +631,54 @@ func uncompressData(reader io.Reader, fileSize, dataSize int) ([]byte, error) {
 				numRead++
 
 				if err != nil {
-					return buffer, err
+					return backingBuffer.Bytes(), err
+				}
+				if err := emit(bufByte); err != nil {
+					return backingBuffer.Bytes(), err
 				}
-
-				buffer[numWrite%bufferSize] = bufByte
-				writer.WriteByte(bufByte)
-				numWrite++
 			} else { // compressed
-				offset, err := readShort(reader)
+				offset, err := readToken(reader)
 				numRead += 2
 
 				if err != nil {
-					return buffer, err
+					return backingBuffer.Bytes(), err
 				}
 
-				numBytes := offset / bufferSize
-				offset %= bufferSize
+				numBytes := int(offset / bufferSize)
+				winOffset := int(offset % bufferSize)
 
-				for m := uint16(0); m <= numBytes+2; m++ {
-					bufByte := buffer[(offset+m)%bufferSize]
-					buffer[numWrite%bufferSize] = bufByte
+				// The back-reference must point at a slot the ring buffer
+				// has actually written; otherwise we'd copy stale/zero data
+				// from a slot that happens to be reused from an earlier,
+				// unrelated position.
+				available := numWrite
+				if available > bufferSize {
+					available = bufferSize
+				}
+				age := 1 + ringMod(numWrite-1-winOffset, bufferSize)
+				if age > available {
+					return backingBuffer.Bytes(), ErrCorruptEntry
+				}
 
-					writer.WriteByte(bufByte)
-					numWrite++
+				for m := 0; m <= numBytes+2; m++ {
+					bufByte := buffer[(winOffset+m)%bufferSize]
+					if err := emit(bufByte); err != nil {
+						return backingBuffer.Bytes(), err
+					}
 				}
 			}
 			cmask /= 2
 		}
 	}
 
-	writer.Flush()
 	return backingBuffer.Bytes(), nil
 }
+
+// ringMod is like a%m but always returns a value in [0, m).
+func ringMod(a, m int) int {
+	r := a % m
+	if r < 0 {
+		r += m
+	}
+	return r
+}
@@ -0,0 +1,79 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func buildBenchArchive(tb testing.TB) string {
+	tb.Helper()
+
+	f, err := os.CreateTemp("", "resource-bench-*.war")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	name := f.Name()
+	tb.Cleanup(func() { os.Remove(name) })
+
+	w, err := NewWriter(f, "DOS Retail", Store)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i, fname := range fileMap {
+		if fname == "" {
+			continue
+		}
+		fw, err := w.Create(i)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := fw.Write(bytes.Repeat([]byte{byte(i)}, 64*1024)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return name
+}
+
+func benchmarkLoadAll(b *testing.B, concurrency int) {
+	path := buildBenchArchive(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		a, err := OpenArchive(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := LoadAllWithOptions(a, LoadAllOptions{Concurrency: concurrency}); err != nil {
+			b.Fatal(err)
+		}
+		a.Close()
+	}
+}
+
+func BenchmarkLoadAllSerial(b *testing.B)     { benchmarkLoadAll(b, 0) }
+func BenchmarkLoadAllConcurrent(b *testing.B) { benchmarkLoadAll(b, 8) }
@@ -0,0 +1,85 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+// buildFullTestArchive writes every named fileMap slot and returns both the
+// opened Archive and the list of names it should contain.
+func buildFullTestArchive(t *testing.T) (*Archive, []string) {
+	t.Helper()
+
+	names := fileNamesFor("DOS Retail")
+	data := make(map[int][]byte)
+	var want []string
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		data[i] = []byte(name + " contents")
+		want = append(want, name)
+	}
+
+	path := writeTempArchive(t, "DOS Retail", Store, data)
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	t.Cleanup(func() { a.Close() })
+
+	return a, want
+}
+
+// TestArchiveWalkDir covers the request's named use case: fs.WalkDir needs
+// Stat(".") and Open(".") to report a directory, not fs.ErrNotExist.
+func TestArchiveWalkDir(t *testing.T) {
+	a, want := buildFullTestArchive(t)
+
+	seen := make(map[string]bool)
+	err := fs.WalkDir(a, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != "." {
+			seen[p] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fs.WalkDir: %v", err)
+	}
+
+	for _, name := range want {
+		if !seen[name] {
+			t.Errorf("fs.WalkDir did not visit %q", name)
+		}
+	}
+}
+
+// TestArchiveFSTest runs the standard library's own fs.FS conformance
+// checker against an Archive.
+func TestArchiveFSTest(t *testing.T) {
+	a, want := buildFullTestArchive(t)
+	if err := fstest.TestFS(a, want...); err != nil {
+		t.Fatal(err)
+	}
+}
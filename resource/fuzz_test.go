@@ -0,0 +1,155 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// seedPlaintexts stand in for real DOS/Shareware entries. Like
+// internal/obscuretestdata in the standard library, the fuzz corpus is
+// built from these at test time rather than from copyrighted game assets
+// checked into the repository.
+var seedPlaintexts = [][]byte{
+	[]byte("HUMANS and ORCS, ORCS and HUMANS, ORCS and ORCS and HUMANS."),
+	bytes.Repeat([]byte("AZEROTH"), 50),
+	{},
+}
+
+func FuzzUncompressData(f *testing.F) {
+	for _, pt := range seedPlaintexts {
+		packed := compressData(pt)
+		f.Add(packed, len(pt), len(packed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, fileSize, dataSize int) {
+		if fileSize < 0 || fileSize > 1<<20 || dataSize < 0 || dataSize > len(data) {
+			t.Skip()
+		}
+
+		out, err := uncompressData(bytes.NewReader(data), fileSize, dataSize)
+		if len(out) > fileSize {
+			t.Fatalf("uncompressData produced %d bytes, declared size was %d", len(out), fileSize)
+		}
+		_ = err
+	})
+}
+
+// buildFuzzArchive writes a small synthetic archive of the given Type,
+// filling every known fileMap slot from payloads (cycled as needed), and
+// returns its bytes along with the name -> payload map it should decode
+// back to.
+func buildFuzzArchive(tb testing.TB, typ string, payloads [][]byte) ([]byte, map[string][]byte) {
+	tb.Helper()
+
+	f, err := os.CreateTemp("", "resource-fuzz-*.war")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	name := f.Name()
+	defer os.Remove(name)
+
+	w, err := NewWriter(f, typ, Compress)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	want := make(map[string][]byte)
+	n := 0
+	for idx, fname := range fileNamesFor(typ) {
+		if fname == "" {
+			continue
+		}
+		fw, err := w.Create(idx)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		payload := payloads[n%len(payloads)]
+		if _, err := fw.Write(payload); err != nil {
+			tb.Fatal(err)
+		}
+		want[fname] = payload
+		n++
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		tb.Fatal(err)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data, want
+}
+
+// fuzzSeed pairs a seed archive's raw bytes with the result LoadAll must
+// produce for it. Mutated inputs the fuzzer derives from these bytes can
+// legitimately fail to open or decode, but the unmutated seed itself must
+// always round-trip, which is the regression FuzzOpenArchive is for.
+type fuzzSeed struct {
+	data []byte
+	want map[string][]byte
+}
+
+func FuzzOpenArchive(f *testing.F) {
+	var seeds []fuzzSeed
+	for _, typ := range []string{"DOS Retail", "DOS Shareware"} {
+		data, want := buildFuzzArchive(f, typ, seedPlaintexts)
+		seeds = append(seeds, fuzzSeed{data, want})
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var seed *fuzzSeed
+		for i := range seeds {
+			if bytes.Equal(data, seeds[i].data) {
+				seed = &seeds[i]
+				break
+			}
+		}
+
+		a, err := OpenArchiveFrom(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			if seed != nil {
+				t.Fatalf("seed archive failed to open: %v", err)
+			}
+			return
+		}
+		got, err := LoadAll(a)
+		if err != nil {
+			if seed != nil {
+				t.Fatalf("seed archive failed to load: %v", err)
+			}
+			return
+		}
+
+		if seed == nil {
+			return
+		}
+		for name, want := range seed.want {
+			if gotData, ok := got[name]; !ok || !bytes.Equal(gotData, want) {
+				t.Fatalf("seed archive entry %q = %q, want %q", name, gotData, want)
+			}
+		}
+	})
+}
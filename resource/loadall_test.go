@@ -0,0 +1,66 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestLoadAllConcurrentMatchesSerial covers the request's parallel
+// extraction path: loadAllConcurrent must return exactly what loadAllSerial
+// does, just in less wall-clock time.
+func TestLoadAllConcurrentMatchesSerial(t *testing.T) {
+	path := buildBenchArchive(t)
+
+	serial, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer serial.Close()
+
+	wantFiles, err := LoadAllWithOptions(serial, LoadAllOptions{Concurrency: 0})
+	if err != nil {
+		t.Fatalf("LoadAllWithOptions(serial): %v", err)
+	}
+
+	concurrent, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer concurrent.Close()
+
+	gotFiles, err := LoadAllWithOptions(concurrent, LoadAllOptions{Concurrency: 8})
+	if err != nil {
+		t.Fatalf("LoadAllWithOptions(concurrent): %v", err)
+	}
+
+	if len(gotFiles) != len(wantFiles) {
+		t.Fatalf("concurrent returned %d files, serial returned %d", len(gotFiles), len(wantFiles))
+	}
+	for name, want := range wantFiles {
+		got, ok := gotFiles[name]
+		if !ok {
+			t.Errorf("concurrent result missing %q", name)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("entry %q differs between serial and concurrent extraction", name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestWriterMacRoundTrip covers the request's own acceptance criterion for
+// Mac support: a Writer-built "Mac Retail" archive, big-endian header and
+// all, must read back correctly through OpenArchive, including a
+// compressed entry run through the Mac LZ variant.
+func TestWriterMacRoundTrip(t *testing.T) {
+	names := fileNamesFor("Mac Retail")
+	if len(names) < 2 {
+		t.Fatalf("macFileMap must have at least 2 entries, has %d", len(names))
+	}
+
+	want := make(map[int][]byte)
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		want[i] = bytes.Repeat([]byte("ORCS and HUMANS "), 50+i)
+		if len(want) == 2 {
+			break
+		}
+	}
+
+	path := writeTempArchive(t, "Mac Retail", Compress, want)
+
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer a.Close()
+
+	got, err := LoadAll(a)
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+
+	for i, wantData := range want {
+		gotData, ok := got[names[i]]
+		if !ok {
+			t.Errorf("entry %d (%q) missing from LoadAll result", i, names[i])
+			continue
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("entry %d (%q) = %q, want %q", i, names[i], gotData, wantData)
+		}
+	}
+}
+
+// TestWriterMacShareware covers the Mac partial-archive case, mirroring
+// TestWriterPartialArchiveRoundTrip but for the big-endian/placeholder
+// convention used by Mac Shareware builds.
+func TestWriterMacShareware(t *testing.T) {
+	names := fileNamesFor("Mac Shareware")
+
+	want := make(map[int][]byte)
+	for i, name := range names {
+		if name == "" || i == len(names)-1 {
+			continue
+		}
+		want[i] = []byte(name + " mac shareware contents")
+	}
+
+	path := writeTempArchive(t, "Mac Shareware", Store, want)
+
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer a.Close()
+
+	got, err := LoadAll(a)
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+
+	for i, wantData := range want {
+		gotData, ok := got[names[i]]
+		if !ok {
+			t.Errorf("entry %d (%q) missing from LoadAll result", i, names[i])
+			continue
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("entry %d (%q) = %q, want %q", i, names[i], gotData, wantData)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Decompressor decodes dataSize bytes of compressed entry data read from
+// reader into the declared fileSize bytes of output. It has the same
+// contract uncompressData has always had.
+type Decompressor func(reader io.Reader, fileSize, dataSize int) ([]byte, error)
+
+var (
+	decompressorMu sync.RWMutex
+	decompressors  = map[byte]Decompressor{
+		0x20: uncompressData,
+		0x21: uncompressDataMac,
+	}
+)
+
+// RegisterDecompressor registers a Decompressor for the compression id
+// stored in the top byte of an entry's size field (see uncompressData and
+// the file header comment). This lets callers plug in the Mac LZ variant,
+// a modern replacement such as zstd for repacked fan archives, or any
+// other scheme without editing this package.
+//
+// Registering for id 0x20 replaces the built-in DOS LZ decoder.
+func RegisterDecompressor(id byte, fn Decompressor) {
+	decompressorMu.Lock()
+	defer decompressorMu.Unlock()
+	decompressors[id] = fn
+}
+
+func decompressorFor(id byte) (Decompressor, bool) {
+	decompressorMu.RLock()
+	defer decompressorMu.RUnlock()
+	fn, ok := decompressors[id]
+	return fn, ok
+}
+
+// archiveKind describes one known Archive ID / Type pairing. supported is
+// false for variants whose on-disk layout is recognized but not yet (or no
+// longer) decoded by OpenArchiveFrom. byteOrder is the endianness of the
+// header, file table and per-entry size fields: DOS builds are
+// little-endian, Mac builds are big-endian. names is the index -> filename
+// table for this Type; OpenArchiveFrom rejects an archive whose numFiles
+// doesn't match len(names).
+type archiveKind struct {
+	id        [4]byte
+	typ       string
+	supported bool
+	byteOrder binary.ByteOrder
+	names     []string
+}
+
+var (
+	archiveKindsMu sync.RWMutex
+	archiveKinds   = []archiveKind{
+		{dosRetail, "DOS Retail", true, binary.LittleEndian, fileMap},
+		{dosShareware, "DOS Shareware", true, binary.LittleEndian, fileMap},
+		{macRetail, "Mac Retail", true, binary.BigEndian, macFileMap},
+		{macShareware, "Mac Shareware", true, binary.BigEndian, macFileMap},
+	}
+)
+
+// RegisterArchiveType registers id as a supported archive Type with the
+// given index -> filename table, so OpenArchiveFrom will
+// decode it instead of returning ErrUnsupportedVersion (or "unknown
+// version" for an id it has never seen before). This is how callers plug
+// in an entirely new WAR variant of their own, e.g. a modern zstd-packed
+// replacement whose entry count differs from the original game's; the Mac
+// variants are already registered built-in. A new id is registered as
+// little-endian; re-registering a known id keeps its existing byte order.
+// Use RegisterFileNames to change the table for a Type that's already
+// registered.
+func RegisterArchiveType(id [4]byte, typ string, names []string) {
+	archiveKindsMu.Lock()
+	defer archiveKindsMu.Unlock()
+
+	for i, k := range archiveKinds {
+		if k.id == id {
+			archiveKinds[i].typ, archiveKinds[i].supported, archiveKinds[i].names = typ, true, names
+			return
+		}
+	}
+	archiveKinds = append(archiveKinds, archiveKind{id, typ, true, binary.LittleEndian, names})
+}
+
+// RegisterFileNames replaces the index -> filename table used for an
+// already-registered archive Type, e.g. to correct the built-in DOS or Mac
+// tables, or to give a custom RegisterArchiveType variant a table with a
+// different entry count after the fact.
+func RegisterFileNames(typ string, names []string) error {
+	archiveKindsMu.Lock()
+	defer archiveKindsMu.Unlock()
+
+	for i, k := range archiveKinds {
+		if k.typ == typ {
+			archiveKinds[i].names = names
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownArchiveType, typ)
+}
+
+func archiveKindForID(id [4]byte) (archiveKind, bool) {
+	archiveKindsMu.RLock()
+	defer archiveKindsMu.RUnlock()
+
+	for _, k := range archiveKinds {
+		if k.id == id {
+			return k, true
+		}
+	}
+	return archiveKind{}, false
+}
+
+func archiveKindForType(typ string) (archiveKind, bool) {
+	archiveKindsMu.RLock()
+	defer archiveKindsMu.RUnlock()
+
+	for _, k := range archiveKinds {
+		if k.supported && k.typ == typ {
+			return k, true
+		}
+	}
+	return archiveKind{}, false
+}
+
+// archiveIDForType looks up the Archive ID registered for a supported Type
+// name, e.g. for use by Writer.
+func archiveIDForType(typ string) ([4]byte, error) {
+	k, ok := archiveKindForType(typ)
+	if !ok {
+		return [4]byte{}, fmt.Errorf("%w: %q", ErrUnknownArchiveType, typ)
+	}
+	return k.id, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestRegisterArchiveTypeCustomNames covers the request's own motivating
+// example: a custom archive type (e.g. a zstd-based repack) whose file
+// count differs from fileMap's must be able to carry its own name table,
+// rather than always being checked against the DOS one.
+func TestRegisterArchiveTypeCustomNames(t *testing.T) {
+	names := []string{"one.bin", "two.bin", "three.bin"}
+	id := [4]byte{'F', 'A', 'N', 0x01}
+	RegisterArchiveType(id, "Fan Repack", names)
+
+	got := fileNamesFor("Fan Repack")
+	if len(got) != len(names) {
+		t.Fatalf("fileNamesFor(%q) = %v, want %v", "Fan Repack", got, names)
+	}
+	for i, name := range names {
+		if got[i] != name {
+			t.Errorf("fileNamesFor(%q)[%d] = %q, want %q", "Fan Repack", i, got[i], name)
+		}
+	}
+
+	want := map[int][]byte{
+		0: []byte("contents of one"),
+		2: []byte("contents of three"),
+	}
+	path := writeTempArchive(t, "Fan Repack", Store, want)
+
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer a.Close()
+
+	got2, err := LoadAll(a)
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	for idx, data := range want {
+		if got, ok := got2[names[idx]]; !ok || !bytes.Equal(got, data) {
+			t.Errorf("entry %q = %q, want %q", names[idx], got, data)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CompressionMode selects whether entries written through a Writer are
+// stored as-is or run through the LZ encoder used by the DOS WAR archives.
+type CompressionMode int
+
+const (
+	// Store writes entries uncompressed.
+	Store CompressionMode = iota
+	// Compress runs entries through the LZ encoder, falling back to Store
+	// for any entry whose compressed form would not end up smaller.
+	Compress
+)
+
+// ErrUnknownArchiveType is returned by NewWriter when asked to produce an
+// archive Type that has no known Archive ID.
+var ErrUnknownArchiveType = errors.New("unknown archive type")
+
+// Writer builds a WAR archive. It mirrors the shape of archive/zip.Writer:
+// callers register files by their fileMap index, stream data into each
+// entry and Close finalizes the header, file table and data section.
+type Writer struct {
+	w    io.WriteSeeker
+	typ  string
+	mode CompressionMode
+
+	entries map[int]*bytes.Buffer
+	closed  bool
+}
+
+// NewWriter returns a Writer that produces an archive of the given Type
+// ("DOS Retail", "DOS Shareware", "Mac Retail", "Mac Shareware") written to
+// w. w must support Seek, since the file table at the start of the archive
+// is only known once every entry has been written.
+func NewWriter(w io.WriteSeeker, typ string, mode CompressionMode) (*Writer, error) {
+	if _, err := archiveIDForType(typ); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, typ: typ, mode: mode, entries: make(map[int]*bytes.Buffer)}, nil
+}
+
+// Create returns a writer for the file at the given fileMap index (the
+// map used depends on the Writer's Type, see fileNamesFor). The returned
+// io.Writer buffers the entry's data until Close.
+func (w *Writer) Create(index int) (io.Writer, error) {
+	if w.closed {
+		return nil, errors.New("resource: Writer closed")
+	}
+	if index < 0 || index >= len(fileNamesFor(w.typ)) {
+		return nil, fmt.Errorf("resource: index %v out of range", index)
+	}
+	if _, ok := w.entries[index]; ok {
+		return nil, fmt.Errorf("resource: index %v already created", index)
+	}
+
+	buf := new(bytes.Buffer)
+	w.entries[index] = buf
+	return buf, nil
+}
+
+// Close finalizes the archive: the header, file table and data section are
+// written out, compressing each entry according to the Writer's
+// CompressionMode. Indices that were never passed to Create are written as
+// placeholders, the same way an incomplete WAR file would be read back.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errors.New("resource: Writer already closed")
+	}
+	w.closed = true
+
+	kind, ok := archiveKindForType(w.typ)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownArchiveType, w.typ)
+	}
+
+	encode := compressData
+	compressionID := byte(0x20)
+	if kind.byteOrder == binary.BigEndian {
+		encode = compressDataMac
+		compressionID = 0x21
+	}
+
+	type entry struct {
+		data       []byte
+		rawSize    int
+		compressed bool
+	}
+
+	numFiles := len(fileNamesFor(w.typ))
+	entries := make(map[int]entry, len(w.entries))
+	for idx, buf := range w.entries {
+		raw := buf.Bytes()
+		data, compressed := raw, false
+		if w.mode == Compress {
+			if packed := encode(raw); len(packed) < len(raw) {
+				data, compressed = packed, true
+			}
+		}
+		entries[idx] = entry{data, len(raw), compressed}
+	}
+
+	headerSize := uint32(4 + 4 + numFiles*4)
+	table := make([]uint32, numFiles)
+	offset := headerSize
+	for i := 0; i < numFiles; i++ {
+		e, ok := entries[i]
+		if !ok {
+			table[i] = 0xFFFFFFFF
+			if kind.byteOrder == binary.BigEndian {
+				table[i] = 0 // Mac archives mark placeholders with 00 00 00 00
+			}
+			continue
+		}
+		table[i] = offset
+		offset += 4 + uint32(len(e.data))
+	}
+
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(kind.id[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, kind.byteOrder, uint32(numFiles)); err != nil {
+		return err
+	}
+	for _, off := range table {
+		if err := binary.Write(w.w, kind.byteOrder, off); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < numFiles; i++ {
+		e, ok := entries[i]
+		if !ok {
+			continue
+		}
+
+		size := uint32(e.rawSize)
+		if e.compressed {
+			size |= uint32(compressionID) << 24
+		}
+		if err := binary.Write(w.w, kind.byteOrder, size); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(e.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compressData produces the LZ-compressed bit stream that uncompressData
+// decodes: an 8-flag control byte followed by up to 8 tokens, where each
+// token is either a literal byte (flag bit set) or a two-byte back-reference
+// (flag bit clear) encoding (runLen-3)*bufferSize + windowOffset against a
+// 4096-byte sliding window. The 16 bit token limits windowOffset to 12 bits
+// and runLen to 3..18. Back-reference tokens are written little-endian, to
+// match the DOS bit stream uncompressData reads.
+func compressData(data []byte) []byte {
+	return compressDataToken(data, binary.LittleEndian)
+}
+
+// compressDataMac is compressData for the Mac bit stream: identical except
+// that back-reference tokens are written big-endian, matching
+// uncompressDataMac.
+func compressDataMac(data []byte) []byte {
+	return compressDataToken(data, binary.BigEndian)
+}
+
+func compressDataToken(data []byte, order binary.ByteOrder) []byte {
+	const (
+		bufferSize = 4096
+		minMatch   = 3
+		maxMatch   = 18
+	)
+
+	var out bytes.Buffer
+	pos, n := 0, len(data)
+
+	var group []uint16
+	var literal []bool
+
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		var flag byte
+		for i, isLit := range literal {
+			if isLit {
+				flag |= 1 << uint(i)
+			}
+		}
+		out.WriteByte(flag)
+		for i, tok := range group {
+			if literal[i] {
+				out.WriteByte(byte(tok))
+			} else {
+				binary.Write(&out, order, tok)
+			}
+		}
+		group, literal = group[:0], literal[:0]
+	}
+
+	for pos < n {
+		length, start := findMatch(data, pos, bufferSize, minMatch, maxMatch)
+		if length >= minMatch {
+			tok := uint16(length-3)*bufferSize + uint16(start%bufferSize)
+			group = append(group, tok)
+			literal = append(literal, false)
+			pos += length
+		} else {
+			group = append(group, uint16(data[pos]))
+			literal = append(literal, true)
+			pos++
+		}
+
+		if len(group) == 8 {
+			flush()
+		}
+	}
+	flush()
+
+	return out.Bytes()
+}
+
+// findMatch looks for the longest run of bytes starting at pos that also
+// occurs within the bufferSize window preceding pos, as required by the
+// ring-buffer back-references uncompressData understands.
+func findMatch(data []byte, pos, bufferSize, minMatch, maxMatch int) (length, start int) {
+	lo := pos - bufferSize
+	if lo < 0 {
+		lo = 0
+	}
+
+	limit := len(data) - pos
+	if limit > maxMatch {
+		limit = maxMatch
+	}
+
+	bestLen, bestStart := 0, 0
+	for s := lo; s < pos; s++ {
+		l := 0
+		for l < limit && data[s+l] == data[pos+l] {
+			l++
+		}
+		if l > bestLen {
+			bestLen, bestStart = l, s
+		}
+	}
+
+	if bestLen < minMatch {
+		return 0, 0
+	}
+	return bestLen, bestStart
+}
@@ -0,0 +1,198 @@
+/*
+Copyright (C) 2016-2018 Andreas T Jonsson
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package resource
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+// writeTempArchive runs w through Create/Close for the given index -> data
+// pairs and returns the path to the resulting file. Indices of fileMap that
+// aren't keys in data are left as placeholders, exercising partial
+// (Shareware/demo-style) archives.
+func writeTempArchive(t *testing.T, typ string, mode CompressionMode, data map[int][]byte) string {
+	t.Helper()
+
+	f, err := os.CreateTemp("", "resource-writer-*.war")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := f.Name()
+	t.Cleanup(func() { os.Remove(name) })
+
+	w, err := NewWriter(f, typ, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, b := range data {
+		fw, err := w.Create(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+// TestWriterPartialArchiveRoundTrip covers a Writer with placeholders: an
+// archive built by Writer must read back unchanged through OpenArchive and
+// LoadAll, including when some fileMap indices are never populated, which
+// is the common case for Shareware/demo builds.
+func TestWriterPartialArchiveRoundTrip(t *testing.T) {
+	names := fileNamesFor("DOS Retail")
+	if len(names) < 2 {
+		t.Fatalf("fileMap must have at least 2 entries, has %d", len(names))
+	}
+
+	want := make(map[int][]byte)
+	for i, name := range names {
+		if name == "" || i == len(names)-1 {
+			continue // leave the last populated slot's neighbour as a placeholder
+		}
+		want[i] = bytes.Repeat([]byte{byte('A' + i%26)}, 37+i)
+	}
+
+	path := writeTempArchive(t, "DOS Retail", Store, want)
+
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer a.Close()
+
+	got, err := LoadAll(a)
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+
+	for i, name := range names {
+		wantData, populated := want[i]
+		if !populated {
+			if _, ok := got[name]; ok && name != "" {
+				t.Errorf("entry %d (%q) should be a placeholder, but was read back", i, name)
+			}
+			continue
+		}
+		gotData, ok := got[name]
+		if !ok {
+			t.Errorf("entry %d (%q) missing from LoadAll result", i, name)
+			continue
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("entry %d (%q) = %q, want %q", i, name, gotData, wantData)
+		}
+	}
+}
+
+// TestWriterSingleEntryArchive covers the single-populated-slot case, which
+// used to compute a bogus dataLength for the entry immediately preceding a
+// run of trailing placeholders.
+func TestWriterSingleEntryArchive(t *testing.T) {
+	names := fileNamesFor("DOS Retail")
+	idx := -1
+	for i, name := range names {
+		if name != "" {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		t.Fatal("fileMap has no named entries")
+	}
+
+	payload := []byte("only entry in an otherwise-empty archive")
+	path := writeTempArchive(t, "DOS Retail", Store, map[int][]byte{idx: payload})
+
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer a.Close()
+
+	sub, err := fs.Sub(a, ".")
+	if err != nil {
+		t.Fatalf("fs.Sub: %v", err)
+	}
+
+	got, err := fs.ReadFile(sub, names[idx])
+	if err != nil {
+		t.Fatalf("ReadFile(%q): %v", names[idx], err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("got %q, want %q", got, payload)
+	}
+}
+
+// TestWriterCompressRoundTrip covers Compress mode, which writes the LZ
+// packed bytes to disk but must still declare the original, pre-compression
+// length in the entry's size field: uncompressData checks its output
+// against that declared size, so writing the on-disk (compressed) length
+// there instead corrupts every entry that actually shrank.
+func TestWriterCompressRoundTrip(t *testing.T) {
+	names := fileNamesFor("DOS Retail")
+
+	want := make(map[int][]byte)
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		want[i] = bytes.Repeat([]byte("HUMANS and ORCS, ORCS and HUMANS. "), 100+i)
+		if len(want) == 2 {
+			break
+		}
+	}
+	if len(want) == 0 {
+		t.Fatal("fileMap has no named entries")
+	}
+
+	path := writeTempArchive(t, "DOS Retail", Compress, want)
+
+	a, err := OpenArchive(path)
+	if err != nil {
+		t.Fatalf("OpenArchive: %v", err)
+	}
+	defer a.Close()
+
+	got, err := LoadAll(a)
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+
+	for i, wantData := range want {
+		gotData, ok := got[names[i]]
+		if !ok {
+			t.Errorf("entry %d (%q) missing from LoadAll result", i, names[i])
+			continue
+		}
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("entry %d (%q) round-tripped to %d bytes, want %d", i, names[i], len(gotData), len(wantData))
+		}
+	}
+}